@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"time"
+
+	cloudevents "github.com/cloudevents/sdk-go/v2/event"
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/google/uuid"
+)
+
+const (
+	cloudEventType   = "com.verve.unique_request_count"
+	cloudEventSource = "/api/verve/accept"
+)
+
+// compressEnabled controls whether encodeUniqueCountEvent gzip-compresses
+// the CloudEvents payload. Set via the COMPRESS env var (COMPRESS=gzip) in
+// main.go's init().
+var compressEnabled bool
+
+// uniqueCountData is the CloudEvents `data` payload for a
+// com.verve.unique_request_count event.
+type uniqueCountData struct {
+	WindowStart    time.Time `json:"window_start"`
+	WindowEnd      time.Time `json:"window_end"`
+	UniqueCount    int64     `json:"unique_count"`
+	DuplicateCount int64     `json:"duplicate_count"`
+}
+
+// uniqueCountSchema is the JSON schema for uniqueCountData, printed by the
+// --schema subcommand so integrators can validate the topic without
+// reading the Go source.
+const uniqueCountSchema = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "com.verve.unique_request_count",
+  "type": "object",
+  "required": ["window_start", "window_end", "unique_count", "duplicate_count"],
+  "properties": {
+    "window_start": {"type": "string", "format": "date-time"},
+    "window_end": {"type": "string", "format": "date-time"},
+    "unique_count": {"type": "integer", "minimum": 0},
+    "duplicate_count": {"type": "integer", "minimum": 0}
+  }
+}`
+
+// buildUniqueCountEvent constructs the CloudEvents v1.0 envelope for a
+// window's unique/duplicate counts.
+func buildUniqueCountEvent(windowStart, windowEnd time.Time, uniqueCount, duplicateCount int64) (cloudevents.Event, error) {
+	evt := cloudevents.New()
+	evt.SetID(uuid.NewString())
+	evt.SetType(cloudEventType)
+	evt.SetSource(cloudEventSource)
+	evt.SetTime(time.Now())
+
+	data := uniqueCountData{
+		WindowStart:    windowStart,
+		WindowEnd:      windowEnd,
+		UniqueCount:    uniqueCount,
+		DuplicateCount: duplicateCount,
+	}
+	if err := evt.SetData("application/json", data); err != nil {
+		return cloudevents.Event{}, fmt.Errorf("setting cloudevent data: %w", err)
+	}
+
+	return evt, nil
+}
+
+// encodeUniqueCountEvent marshals the event to JSON and, if compression is
+// enabled via the COMPRESS env var, gzip-compresses it. It returns the
+// encoded payload along with the Kafka headers that describe it.
+func encodeUniqueCountEvent(evt cloudevents.Event) ([]byte, []kafka.Header, error) {
+	payload, err := evt.MarshalJSON()
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshaling cloudevent: %w", err)
+	}
+
+	headers := []kafka.Header{{Key: "content-type", Value: []byte("application/cloudevents+json")}}
+
+	if compressEnabled {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(payload); err != nil {
+			return nil, nil, fmt.Errorf("gzip-compressing cloudevent: %w", err)
+		}
+		if err := gz.Close(); err != nil {
+			return nil, nil, fmt.Errorf("closing gzip writer: %w", err)
+		}
+		payload = buf.Bytes()
+		headers = append(headers, kafka.Header{Key: "content-encoding", Value: []byte("gzip")})
+	}
+
+	return payload, headers, nil
+}
+
+// printSchema writes the JSON schema for the unique-count CloudEvents data
+// payload to stdout. Invoked via `--schema`.
+func printSchema() {
+	fmt.Println(uniqueCountSchema)
+}
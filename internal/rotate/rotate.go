@@ -0,0 +1,221 @@
+// Package rotate implements size- and time-based rotation for append-only
+// log files, in the style of the classic Apache access-log rotator: the
+// current file is renamed with a timestamp plus a free numeric suffix,
+// then a fresh file is opened in its place.
+package rotate
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Interval selects the time-based rotation boundary. RotateSize disables
+// time-based rotation and relies on MaxBytes alone.
+type Interval string
+
+const (
+	RotateDaily  Interval = "daily"
+	RotateHourly Interval = "hourly"
+	RotateSize   Interval = "size"
+)
+
+// Config controls a Rotator's rotation thresholds and retention.
+type Config struct {
+	MaxBytes int64    // rotate when the file would exceed this size; 0 disables size-based rotation
+	Interval Interval // rotate on a UTC day/hour boundary, or never (RotateSize)
+	Backups  int      // number of rotated archives to keep; older ones are deleted
+	Gzip     bool     // gzip-compress rotated archives in the background
+}
+
+// Rotator wraps an append-only log file, transparently rotating it when it
+// crosses Config.MaxBytes or a Config.Interval boundary. It implements
+// io.WriteCloser so it can be used anywhere an *os.File writer was used.
+type Rotator struct {
+	mu   sync.Mutex
+	path string
+	cfg  Config
+
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// New opens path (creating it if necessary) and returns a Rotator that
+// writes to it, rotating according to cfg.
+func New(path string, cfg Config) (*Rotator, error) {
+	r := &Rotator{path: path, cfg: cfg}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Rotator) open() error {
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return fmt.Errorf("rotate: opening %s: %w", r.path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("rotate: stat %s: %w", r.path, err)
+	}
+
+	r.file = f
+	r.size = info.Size()
+	r.openedAt = time.Now().UTC()
+	return nil
+}
+
+// Write implements io.Writer, rotating first if p would push the current
+// file past a configured threshold.
+func (r *Rotator) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.needsRotation(len(p)) {
+		if err := r.rotate(); err != nil {
+			log.Printf("rotate: failed to rotate %s: %v", r.path, err)
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *Rotator) needsRotation(nextWriteLen int) bool {
+	if r.cfg.MaxBytes > 0 && r.size+int64(nextWriteLen) > r.cfg.MaxBytes {
+		return true
+	}
+
+	now := time.Now().UTC()
+	switch r.cfg.Interval {
+	case RotateDaily:
+		return !now.Truncate(24 * time.Hour).Equal(r.openedAt.Truncate(24 * time.Hour))
+	case RotateHourly:
+		return !now.Truncate(time.Hour).Equal(r.openedAt.Truncate(time.Hour))
+	default:
+		return false
+	}
+}
+
+// rotate renames the current file to a timestamped archive name, reopens
+// path fresh, prunes old archives, and optionally gzips the one just
+// created. Callers must hold r.mu.
+func (r *Rotator) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("rotate: closing %s: %w", r.path, err)
+	}
+
+	archivePath, err := nextArchiveName(r.path, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(r.path, archivePath); err != nil {
+		return fmt.Errorf("rotate: renaming %s to %s: %w", r.path, archivePath, err)
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	if r.cfg.Gzip {
+		go gzipAndRemove(archivePath)
+	}
+
+	pruneBackups(r.path, r.cfg.Backups)
+	return nil
+}
+
+// nextArchiveName finds the first unused "<path>.<YYYYMMDD-HHMMSS>.<NNN>"
+// suffix for the given rotation time, the classic access-log rotator
+// pattern for avoiding collisions between rotations in the same second.
+func nextArchiveName(path string, at time.Time) (string, error) {
+	stamp := at.Format("20060102-150405")
+	for n := 1; n <= 999; n++ {
+		candidate := fmt.Sprintf("%s.%s.%03d", path, stamp, n)
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("rotate: exhausted archive suffixes for %s at %s", path, stamp)
+}
+
+// gzipAndRemove compresses archivePath to archivePath+".gz" and removes
+// the uncompressed archive on success. Run in the background so it does
+// not block the writer.
+func gzipAndRemove(archivePath string) {
+	src, err := os.Open(archivePath)
+	if err != nil {
+		log.Printf("rotate: gzip: opening %s: %v", archivePath, err)
+		return
+	}
+	defer src.Close()
+
+	dstPath := archivePath + ".gz"
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		log.Printf("rotate: gzip: creating %s: %v", dstPath, err)
+		return
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		log.Printf("rotate: gzip: compressing %s: %v", archivePath, err)
+		gz.Close()
+		dst.Close()
+		return
+	}
+	if err := gz.Close(); err != nil {
+		log.Printf("rotate: gzip: closing writer for %s: %v", dstPath, err)
+	}
+	if err := dst.Close(); err != nil {
+		log.Printf("rotate: gzip: closing %s: %v", dstPath, err)
+	}
+
+	if err := os.Remove(archivePath); err != nil {
+		log.Printf("rotate: gzip: removing %s: %v", archivePath, err)
+	}
+}
+
+// pruneBackups keeps the `backups` most recent archives for path and
+// deletes the rest. backups <= 0 disables pruning.
+func pruneBackups(path string, backups int) {
+	if backups <= 0 {
+		return
+	}
+
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		log.Printf("rotate: listing archives for %s: %v", path, err)
+		return
+	}
+	if len(matches) <= backups {
+		return
+	}
+
+	// Archive names are "<path>.<YYYYMMDD-HHMMSS>.<NNN>[.gz]", which sorts
+	// chronologically as plain strings.
+	sort.Strings(matches)
+
+	for _, old := range matches[:len(matches)-backups] {
+		if err := os.Remove(old); err != nil {
+			log.Printf("rotate: removing old archive %s: %v", old, err)
+		}
+	}
+}
+
+// Close closes the underlying file.
+func (r *Rotator) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
@@ -0,0 +1,135 @@
+package rotate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatorRotatesOnMaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.log")
+
+	r, err := New(path, Config{MaxBytes: 10, Interval: RotateSize, Backups: 5, Gzip: false})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer r.Close()
+
+	if _, err := r.Write([]byte("12345")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if _, err := r.Write([]byte("67890")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	// This write pushes the file past MaxBytes, so it should rotate first.
+	if _, err := r.Write([]byte("abcde")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 archive after rotation, got %d: %v", len(matches), matches)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat current file: %v", err)
+	}
+	if info.Size() != 5 {
+		t.Fatalf("expected current file to contain only the post-rotation write (5 bytes), got %d", info.Size())
+	}
+}
+
+func TestRotatorRotatesOnDailyBoundary(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.log")
+
+	r, err := New(path, Config{Interval: RotateDaily, Backups: 5})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer r.Close()
+
+	// Force the rotator to believe it was opened yesterday so the next
+	// write crosses a UTC day boundary.
+	r.openedAt = time.Now().UTC().Add(-24 * time.Hour)
+
+	if _, err := r.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 archive after crossing the daily boundary, got %d: %v", len(matches), matches)
+	}
+}
+
+func TestRotatorPrunesOldBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.log")
+
+	r, err := New(path, Config{MaxBytes: 1, Interval: RotateSize, Backups: 2, Gzip: false})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer r.Close()
+
+	for i := 0; i < 5; i++ {
+		if _, err := r.Write([]byte("x")); err != nil {
+			t.Fatalf("Write %d: %v", i, err)
+		}
+		// nextArchiveName dedupes by second-resolution timestamp, so space
+		// out writes enough to get distinct archive names.
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	}
+	if len(matches) > 2 {
+		t.Fatalf("expected at most 2 retained backups, got %d: %v", len(matches), matches)
+	}
+}
+
+func TestRotatorGzipsArchives(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.log")
+
+	r, err := New(path, Config{MaxBytes: 1, Interval: RotateSize, Backups: 5, Gzip: true})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer r.Close()
+
+	if _, err := r.Write([]byte("x")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if _, err := r.Write([]byte("y")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	var gzMatches []string
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		gzMatches, err = filepath.Glob(path + ".*.gz")
+		if err != nil {
+			t.Fatalf("Glob: %v", err)
+		}
+		if len(gzMatches) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(gzMatches) == 0 {
+		t.Fatal("expected a gzipped archive to appear")
+	}
+}
@@ -1,19 +1,21 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/go-redis/redis/v8"
+	"github.com/swaroopr117/Unique_Request_Counter/internal/rotate"
 )
 
 // Redis configuration and Kafka setup
@@ -22,10 +24,33 @@ var (
 	redisClient    = redis.NewClient(&redis.Options{Addr: "localhost:6379"})
 	kafkaProducer  *kafka.Producer
 	kafkaTopic     = "unique-request-count"
-	requestLogFile *os.File
+	requestLogFile *rotate.Rotator
 	mutex          = &sync.Mutex{}
 )
 
+const defaultLogMaxBytes = 100 * 1024 * 1024 // 100MB
+
+// store is the dedup/counting backend used by trackUniqueRequest and
+// LogUniqueRequests. See store.go for the Store interface and its
+// implementations; the active backend is selected via the STORE env var.
+var store Store
+
+// hllSlidingWindow controls how many minutes the sliding-window count
+// reported by LogUniqueRequests spans.
+var hllSlidingWindow = 5
+
+// duplicateCount counts requests rejected as duplicates since the last
+// time LogUniqueRequests reported a window, for inclusion in the emitted
+// CloudEvent's duplicate_count field.
+var duplicateCount int64
+
+// Shutdown configuration, overridable via env vars so operators can tune
+// the drain window without a rebuild.
+var (
+	shutdownDrainTimeout = 10 * time.Second // SHUTDOWN_TIMEOUT, parsed as a time.Duration string (e.g. "15s")
+	kafkaFlushTimeoutMs  = 5000             // KAFKA_FLUSH_TIMEOUT_MS
+)
+
 func init() {
 	// Initialize Kafka producer
 	var err error
@@ -34,23 +59,161 @@ func init() {
 		log.Fatalf("Failed to create Kafka producer: %v", err)
 	}
 
-	// Open the log file for writing
-	requestLogFile, err = os.OpenFile("request_count.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	// Open the log file for writing, with size/time-based rotation
+	requestLogFile, err = rotate.New("request_count.log", logRotateConfigFromEnv())
 	if err != nil {
 		log.Fatalf("Failed to open log file: %v", err)
 	}
+
+	store, err = newStoreFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize store: %v", err)
+	}
+
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			shutdownDrainTimeout = d
+		} else {
+			log.Printf("Ignoring invalid SHUTDOWN_TIMEOUT %q: %v", v, err)
+		}
+	}
+	if v := os.Getenv("KAFKA_FLUSH_TIMEOUT_MS"); v != "" {
+		if ms, err := strconv.Atoi(v); err == nil {
+			kafkaFlushTimeoutMs = ms
+		} else {
+			log.Printf("Ignoring invalid KAFKA_FLUSH_TIMEOUT_MS %q: %v", v, err)
+		}
+	}
+
+	compressEnabled = os.Getenv("COMPRESS") == "gzip"
+}
+
+// logRotateConfigFromEnv builds the request_count.log rotation config from
+// LOG_MAX_BYTES, LOG_ROTATE (daily|hourly|size), LOG_BACKUPS, and LOG_GZIP.
+func logRotateConfigFromEnv() rotate.Config {
+	cfg := rotate.Config{
+		MaxBytes: defaultLogMaxBytes,
+		Interval: rotate.RotateSize,
+		Backups:  5,
+		Gzip:     true,
+	}
+
+	if v := os.Getenv("LOG_MAX_BYTES"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			cfg.MaxBytes = n
+		} else {
+			log.Printf("Ignoring invalid LOG_MAX_BYTES %q: %v", v, err)
+		}
+	}
+	if v := os.Getenv("LOG_ROTATE"); v != "" {
+		switch rotate.Interval(v) {
+		case rotate.RotateDaily, rotate.RotateHourly, rotate.RotateSize:
+			cfg.Interval = rotate.Interval(v)
+		default:
+			log.Printf("Ignoring invalid LOG_ROTATE %q (want daily|hourly|size)", v)
+		}
+	}
+	if v := os.Getenv("LOG_BACKUPS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Backups = n
+		} else {
+			log.Printf("Ignoring invalid LOG_BACKUPS %q: %v", v, err)
+		}
+	}
+	if v := os.Getenv("LOG_GZIP"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Gzip = b
+		} else {
+			log.Printf("Ignoring invalid LOG_GZIP %q: %v", v, err)
+		}
+	}
+
+	return cfg
 }
 
 func main() {
-	defer kafkaProducer.Close()
+	if len(os.Args) > 1 && os.Args[1] == "--schema" {
+		printSchema()
+		return
+	}
+
 	defer requestLogFile.Close() // Ensure the log file is closed on exit
+	defer store.Close()
+
+	go drainKafkaEvents()
 
-	http.HandleFunc("/api/verve/accept", RequestHandler)
-	go LogUniqueRequests()
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	go LogUniqueRequests(bgCtx)
 
-	fmt.Println("Starting server on port 8080...")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		log.Fatalf("Error starting server: %v", err)
+	webhookCtx, stopWebhookWorkers := context.WithCancel(context.Background())
+	defer stopWebhookWorkers()
+	startWebhookWorkers(webhookCtx)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/verve/accept", RequestHandler)
+	srv := &http.Server{Addr: ":8080", Handler: mux}
+
+	serverErrs := make(chan error, 1)
+	go func() {
+		fmt.Println("Starting server on port 8080...")
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			serverErrs <- err
+			return
+		}
+		close(serverErrs)
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case sig := <-sigCh:
+		log.Printf("Received %s, starting graceful shutdown", sig)
+	case err := <-serverErrs:
+		if err != nil {
+			log.Printf("HTTP server error: %v", err)
+		}
+	}
+
+	if err := gracefulShutdown(srv, shutdownDrainTimeout, stopBackground, stopWebhookWorkers); err != nil {
+		log.Printf("Error shutting down HTTP server: %v", err)
+	}
+
+	kafkaProducer.Flush(kafkaFlushTimeoutMs)
+	kafkaProducer.Close()
+}
+
+// gracefulShutdown stops background ticking, drains srv's in-flight
+// requests within timeout, and only then stops the webhook workers: a
+// handler still running during the drain can enqueue a webhook, and a
+// worker needs to stay alive to pick it up. Returns srv.Shutdown's error,
+// if any.
+func gracefulShutdown(srv *http.Server, timeout time.Duration, stopBackground, stopWebhookWorkers func()) error {
+	stopBackground()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+
+	stopWebhookWorkers()
+
+	return err
+}
+
+// drainKafkaEvents consumes kafkaProducer.Events() for the lifetime of the
+// process and logs delivery failures, since Produce is called with a nil
+// delivery channel (reports route to this shared events channel instead).
+func drainKafkaEvents() {
+	for e := range kafkaProducer.Events() {
+		switch ev := e.(type) {
+		case *kafka.Message:
+			if ev.TopicPartition.Error != nil {
+				log.Printf("Kafka delivery failed for topic %s: %v", *ev.TopicPartition.Topic, ev.TopicPartition.Error)
+			}
+		case kafka.Error:
+			log.Printf("Kafka producer error: %v", ev)
+		}
 	}
 }
 
@@ -69,7 +232,7 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Track unique request in Redis with a 1 minute expiration
+	// Track unique request via the configured Store
 	isUnique, err := trackUniqueRequest(id)
 	if err != nil {
 		http.Error(w, "failed", http.StatusInternalServerError)
@@ -77,92 +240,102 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !isUnique {
+		atomic.AddInt64(&duplicateCount, 1)
 		http.Error(w, "failed: Duplicate", http.StatusConflict)
 		return
 	}
 
-	// If an endpoint is provided, make a POST request with unique count data
+	// If an endpoint is provided, enqueue it for asynchronous webhook
+	// delivery rather than blocking this request on downstream availability.
 	endpoint := r.URL.Query().Get("endpoint")
 	if endpoint != "" {
-		if err := triggerEndpoint(endpoint); err != nil {
-			http.Error(w, "failed", http.StatusInternalServerError)
+		if err := enqueueWebhook(endpoint); err != nil {
+			log.Printf("Error enqueuing webhook for %s: %v", endpoint, err)
+			http.Error(w, "failed: webhook queue full", http.StatusServiceUnavailable)
 			return
 		}
+		w.WriteHeader(http.StatusAccepted)
+		return
 	}
 
 	_, _ = w.Write([]byte("ok"))
 }
 
-// trackUniqueRequest stores the ID in Redis and returns true if it was unique (not present in the last minute)
+// trackUniqueRequest records the ID with the configured Store and returns
+// true if it was unique (not seen in the last minute).
 func trackUniqueRequest(id int) (bool, error) {
-	key := fmt.Sprintf("request_id:%d", id)
-	isUnique, err := redisClient.SetNX(ctx, key, true, time.Minute).Result()
-	if err != nil {
-		log.Printf("Error interacting with Redis: %v", err)
-		return false, err
-	}
-	return isUnique, nil
+	return store.MarkUnique(id, time.Minute)
 }
 
-// triggerEndpoint sends a POST request to the specified endpoint with a message payload
-func triggerEndpoint(endpoint string) error {
-	data := map[string]string{
-		"message": "Unique request data",
-	}
+// LogUniqueRequests runs every minute until ctx is cancelled, estimating
+// the unique request cardinality for the minute that just closed
+// (exact-minute count) and for the trailing hllSlidingWindow minutes
+// (sliding-window count) via the configured Store, then emits both metrics
+// to Kafka and the log file.
+func LogUniqueRequests(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
 
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		log.Printf("Error encoding JSON data: %v", err)
-		return err
-	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 
-	resp, err := http.Post(endpoint, "application/json", bytes.NewReader(jsonData))
-	if err != nil {
-		log.Printf("Error making request to endpoint: %v", err)
-		return err
-	}
-	defer resp.Body.Close()
+		mutex.Lock()
 
-	log.Printf("Triggered endpoint: %s with status code: %d", endpoint, resp.StatusCode)
-	return nil
-}
+		windowEnd := time.Now()
+		windowStart := windowEnd.Add(-time.Minute)
 
-// LogUniqueRequests sends the unique count of requests to Kafka and logs it to a file every minute
-func LogUniqueRequests() {
-	for range time.Tick(time.Minute) {
-		mutex.Lock()
-		keys, err := redisClient.Keys(ctx, "request_id:*").Result()
+		exactCount, err := store.CountAndReset(time.Minute)
 		if err != nil {
-			log.Printf("Error fetching keys from Redis: %v", err)
+			log.Printf("Error counting unique requests for the last minute: %v", err)
 			mutex.Unlock()
 			continue
 		}
 
-		uniqueCount := len(keys)
-		log.Printf("Sending unique request count to Kafka: %d", uniqueCount)
+		slidingCount, err := store.CountAndReset(time.Duration(hllSlidingWindow) * time.Minute)
+		if err != nil {
+			log.Printf("Error counting unique requests for the last %dm: %v", hllSlidingWindow, err)
+			mutex.Unlock()
+			continue
+		}
 
-		// Prepare Kafka message
-		message := kafka.Message{
-			TopicPartition: kafka.TopicPartition{Topic: &kafkaTopic, Partition: kafka.PartitionAny},
-			Value:          []byte(fmt.Sprintf("Unique request count in last minute: %d", uniqueCount)),
+		duplicates := atomic.SwapInt64(&duplicateCount, 0)
+
+		log.Printf("Sending unique request counts to Kafka: minute=%d sliding(%dm)=%d duplicates=%d", exactCount, hllSlidingWindow, slidingCount, duplicates)
+
+		evt, err := buildUniqueCountEvent(windowStart, windowEnd, exactCount, duplicates)
+		if err != nil {
+			log.Printf("Error building CloudEvent: %v", err)
+			mutex.Unlock()
+			continue
 		}
 
-		// Produce message to Kafka
-		err = kafkaProducer.Produce(&message, nil)
+		payload, headers, err := encodeUniqueCountEvent(evt)
 		if err != nil {
+			log.Printf("Error encoding CloudEvent: %v", err)
+			mutex.Unlock()
+			continue
+		}
+
+		// Produce message to Kafka
+		message := kafka.Message{
+			TopicPartition: kafka.TopicPartition{Topic: &kafkaTopic, Partition: kafka.PartitionAny},
+			Value:          payload,
+			Headers:        headers,
+		}
+		if err := kafkaProducer.Produce(&message, nil); err != nil {
 			log.Printf("Error sending message to Kafka: %v", err)
 		}
 
 		// Log the unique count to the file
-		_, err = fmt.Fprintf(requestLogFile, "Unique request count in last minute: %d\n", uniqueCount)
+		_, err = fmt.Fprintf(requestLogFile, "Unique request count in last minute: %d (last %dm: %d, duplicates: %d)\n", exactCount, hllSlidingWindow, slidingCount, duplicates)
 		if err != nil {
 			log.Printf("Error writing to log file: %v", err)
 		}
 
-		// Cleanup Redis keys after logging
-		for _, key := range keys {
-			redisClient.Del(ctx, key)
-		}
 		mutex.Unlock()
 	}
 }
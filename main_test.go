@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// mockStore is a minimal Store used to exercise RequestHandler in tests
+// without a real backend.
+type mockStore struct{}
+
+func (mockStore) MarkUnique(id int, ttl time.Duration) (bool, error) { return true, nil }
+func (mockStore) CountAndReset(window time.Duration) (int64, error)  { return 0, nil }
+func (mockStore) Close() error                                       { return nil }
+
+// TestGracefulShutdownWaitsForInFlightRequestsBeforeStoppingWebhookWorkers
+// proves the shutdown sequence completes within a bounded time, and that it
+// does not stop the webhook workers until the in-flight request has
+// drained.
+func TestGracefulShutdownWaitsForInFlightRequestsBeforeStoppingWebhookWorkers(t *testing.T) {
+	store = mockStore{}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	_, stopBackground := context.WithCancel(context.Background())
+	webhookCtx, cancelWebhookCtx := context.WithCancel(context.Background())
+
+	releasedAt := make(chan time.Time, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		releasedAt <- time.Now()
+		close(release)
+	}()
+
+	webhookStoppedAt := make(chan time.Time, 1)
+	stopWebhookWorkers := func() {
+		cancelWebhookCtx()
+		webhookStoppedAt <- time.Now()
+	}
+
+	done := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		done <- gracefulShutdown(srv, time.Second, stopBackground, stopWebhookWorkers)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("gracefulShutdown returned error: %v", err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("gracefulShutdown did not complete within a bounded time")
+	}
+
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatal("gracefulShutdown returned before the in-flight handler released")
+	}
+
+	select {
+	case released := <-releasedAt:
+		stopped := <-webhookStoppedAt
+		if stopped.Before(released) {
+			t.Fatal("webhook workers were stopped before the in-flight request drained")
+		}
+	default:
+		t.Fatal("handler was never released")
+	}
+
+	select {
+	case <-webhookCtx.Done():
+	default:
+		t.Fatal("webhook context was not cancelled")
+	}
+}
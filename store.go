@@ -0,0 +1,341 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Store abstracts the dedup/counting backend so the service can run
+// against Redis in production, an in-process map for tests and single-node
+// deployments, or LevelDB for embedded persistence across restarts. The
+// backend is selected by the STORE env var (redis|memory|leveldb, default
+// redis) in newStoreFromEnv.
+type Store interface {
+	// MarkUnique records id as seen and returns true if it was not already
+	// present within ttl.
+	MarkUnique(id int, ttl time.Duration) (bool, error)
+	// CountAndReset returns the estimated number of unique ids recorded in
+	// the trailing window. Implementations prune state older than a fixed
+	// retention ceiling, not older than window itself, since callers may
+	// invoke this with different windows back-to-back against the same
+	// underlying state (see LogUniqueRequests).
+	CountAndReset(window time.Duration) (int64, error)
+	Close() error
+}
+
+// newStoreFromEnv selects a Store implementation based on the STORE
+// environment variable. Unknown or unset values default to "redis".
+func newStoreFromEnv() (Store, error) {
+	switch os.Getenv("STORE") {
+	case "memory":
+		log.Printf("Using in-memory store")
+		return newMemoryStore(), nil
+	case "leveldb":
+		log.Printf("Using LevelDB store")
+		return newLevelDBStore(os.Getenv("LEVELDB_PATH"))
+	case "redis", "":
+		log.Printf("Using Redis store")
+		return &redisStore{}, nil
+	default:
+		return nil, fmt.Errorf("unknown STORE %q (want redis|memory|leveldb)", os.Getenv("STORE"))
+	}
+}
+
+// redisStore is the production Store backed by Redis. Per-id dedup uses a
+// plain SetNX key; cardinality is tracked separately via a HyperLogLog
+// bucket per hllBucketWidth (PFADD unique:req:<bucket>) so CountAndReset
+// never has to scan or hold the full id set in memory. Redis' HLL
+// implementation has a fixed standard error of ~0.81%, an acceptable
+// tradeoff for an approximate "unique requests per window" metric at this
+// volume; the register size (hllRegisterSize, 2^14 dense registers) is not
+// runtime-tunable in Redis but is documented here for reference.
+type redisStore struct{}
+
+var (
+	hllBucketWidth      = time.Minute // width of a single PFADD bucket
+	hllBucketExpiry     = time.Hour   // TTL applied to each bucket key
+	hllRetentionBuckets = int64(60)   // buckets older than this (in bucket units) are pruned eagerly
+	hllRegisterSize     = 14          // documented HLL register size; see type doc comment
+)
+
+// hllBucketKey returns the HLL key for the given minute bucket number.
+func hllBucketKey(bucket int64) string {
+	return fmt.Sprintf("unique:req:%d", bucket)
+}
+
+// currentBucket returns the bucket number for the current minute.
+func currentBucket() int64 {
+	return time.Now().Unix() / int64(hllBucketWidth.Seconds())
+}
+
+func (redisStore) MarkUnique(id int, ttl time.Duration) (bool, error) {
+	bucketKey := hllBucketKey(currentBucket())
+	if err := redisClient.PFAdd(ctx, bucketKey, id).Err(); err != nil {
+		log.Printf("Error adding to HyperLogLog bucket %s: %v", bucketKey, err)
+		return false, err
+	}
+	if err := redisClient.Expire(ctx, bucketKey, hllBucketExpiry).Err(); err != nil {
+		log.Printf("Error setting expiry on HyperLogLog bucket %s: %v", bucketKey, err)
+		return false, err
+	}
+
+	key := fmt.Sprintf("request_id:%d", id)
+	isUnique, err := redisClient.SetNX(ctx, key, true, ttl).Result()
+	if err != nil {
+		log.Printf("Error interacting with Redis: %v", err)
+		return false, err
+	}
+	return isUnique, nil
+}
+
+func (redisStore) CountAndReset(window time.Duration) (int64, error) {
+	buckets := int64(window / hllBucketWidth)
+	if buckets < 1 {
+		buckets = 1
+	}
+
+	end := currentBucket() - 1
+	count, err := mergeBucketRange(end-buckets+1, end)
+	if err != nil {
+		return 0, err
+	}
+
+	pruneOldBuckets(end)
+	return count, nil
+}
+
+// mergeBucketRange merges the HyperLogLog buckets from start to end
+// (inclusive) into a scratch key and returns its cardinality.
+func mergeBucketRange(start, end int64) (int64, error) {
+	scratchKey := fmt.Sprintf("unique:req:merge:%d-%d", start, end)
+	bucketKeys := make([]string, 0, end-start+1)
+	for b := start; b <= end; b++ {
+		bucketKeys = append(bucketKeys, hllBucketKey(b))
+	}
+
+	if err := redisClient.PFMerge(ctx, scratchKey, bucketKeys...).Err(); err != nil {
+		return 0, err
+	}
+	defer redisClient.Del(ctx, scratchKey)
+
+	return redisClient.PFCount(ctx, scratchKey).Result()
+}
+
+// pruneOldBuckets deletes the HyperLogLog bucket that just fell outside of
+// hllRetentionBuckets relative to currentBucket, rather than deleting
+// per-id keys. Buckets also carry a TTL (hllBucketExpiry) as a backstop.
+func pruneOldBuckets(currentBucket int64) {
+	expired := currentBucket - hllRetentionBuckets
+	redisClient.Del(ctx, hllBucketKey(expired))
+}
+
+func (redisStore) Close() error {
+	return redisClient.Close()
+}
+
+// memoryStore is an in-process Store for single-node deployments and
+// tests. It keeps a map of id -> expiry for MarkUnique, evicted lazily via
+// a min-heap ordered by expiry, plus a time-ordered log of sightings used
+// by CountAndReset to estimate the window cardinality.
+type memoryStore struct {
+	mu      sync.Mutex
+	expiry  map[int]time.Time
+	heap    expirationHeap
+	seenLog []seenEntry
+}
+
+// seenRetention bounds how long a sighting is kept in seenLog/LevelDB
+// regardless of the window requested of CountAndReset, mirroring
+// hllRetentionBuckets for redisStore. LogUniqueRequests calls CountAndReset
+// twice per tick with different windows (the exact minute, then the
+// hllSlidingWindow-minute sliding count) against the same store, so pruning
+// to the requested window would delete sightings the second, wider call
+// still needs to see; pruning to a fixed ceiling instead keeps both calls
+// correct as long as the ceiling covers the widest window in use.
+var seenRetention = time.Hour
+
+type seenEntry struct {
+	id int
+	at time.Time
+}
+
+type expirationHeap []seenEntry
+
+func (h expirationHeap) Len() int            { return len(h) }
+func (h expirationHeap) Less(i, j int) bool  { return h[i].at.Before(h[j].at) }
+func (h expirationHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *expirationHeap) Push(x interface{}) { *h = append(*h, x.(seenEntry)) }
+func (h *expirationHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{expiry: make(map[int]time.Time)}
+}
+
+func (s *memoryStore) MarkUnique(id int, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.evictExpired(now)
+
+	if expiresAt, ok := s.expiry[id]; ok && expiresAt.After(now) {
+		return false, nil
+	}
+
+	expiresAt := now.Add(ttl)
+	s.expiry[id] = expiresAt
+	heap.Push(&s.heap, seenEntry{id: id, at: expiresAt})
+	s.seenLog = append(s.seenLog, seenEntry{id: id, at: now})
+	return true, nil
+}
+
+func (s *memoryStore) CountAndReset(window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	countCutoff := now.Add(-window)
+	pruneCutoff := now.Add(-seenRetention)
+
+	distinct := make(map[int]struct{})
+	kept := s.seenLog[:0]
+	for _, e := range s.seenLog {
+		if e.at.After(countCutoff) {
+			distinct[e.id] = struct{}{}
+		}
+		if e.at.After(pruneCutoff) {
+			kept = append(kept, e)
+		}
+	}
+	s.seenLog = kept
+
+	return int64(len(distinct)), nil
+}
+
+// evictExpired pops ids whose dedup TTL has elapsed off the heap. A heap
+// entry is only acted on if it still matches the live expiry for that id,
+// since a later MarkUnique call may have pushed a newer entry.
+func (s *memoryStore) evictExpired(now time.Time) {
+	for s.heap.Len() > 0 && s.heap[0].at.Before(now) {
+		entry := heap.Pop(&s.heap).(seenEntry)
+		if expiresAt, ok := s.expiry[entry.id]; ok && expiresAt.Equal(entry.at) {
+			delete(s.expiry, entry.id)
+		}
+	}
+}
+
+func (s *memoryStore) Close() error { return nil }
+
+// levelDBStore persists dedup and sighting state across restarts using a
+// LevelDB database on disk. Dedup entries are keyed "dedup:<id>" with the
+// expiry encoded as the value; sightings are keyed "seen:<unixnano>:<id>"
+// so CountAndReset can range-scan by time.
+type levelDBStore struct {
+	mu sync.Mutex
+	db *leveldb.DB
+}
+
+func newLevelDBStore(path string) (*levelDBStore, error) {
+	if path == "" {
+		path = "unique_request_counter.leveldb"
+	}
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("opening leveldb at %s: %w", path, err)
+	}
+	return &levelDBStore{db: db}, nil
+}
+
+func dedupKey(id int) []byte {
+	return []byte(fmt.Sprintf("dedup:%d", id))
+}
+
+func seenKey(at time.Time, id int) []byte {
+	return []byte(fmt.Sprintf("seen:%020d:%d", at.UnixNano(), id))
+}
+
+func encodeExpiry(t time.Time) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(t.UnixNano()))
+	return buf
+}
+
+func decodeExpiry(b []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b)))
+}
+
+func (s *levelDBStore) MarkUnique(id int, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	val, err := s.db.Get(dedupKey(id), nil)
+	if err != nil && err != leveldb.ErrNotFound {
+		return false, err
+	}
+	if err == nil && decodeExpiry(val).After(now) {
+		return false, nil
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Put(dedupKey(id), encodeExpiry(now.Add(ttl)))
+	batch.Put(seenKey(now, id), nil)
+	if err := s.db.Write(batch, nil); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *levelDBStore) CountAndReset(window time.Duration) (int64, error) {
+	now := time.Now()
+	countCutoff := now.Add(-window)
+	pruneCutoff := now.Add(-seenRetention)
+
+	iter := s.db.NewIterator(util.BytesPrefix([]byte("seen:")), nil)
+	defer iter.Release()
+
+	distinct := make(map[int]struct{})
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		key := string(iter.Key())
+		var nanos int64
+		var id int
+		if _, err := fmt.Sscanf(key, "seen:%020d:%d", &nanos, &id); err != nil {
+			continue
+		}
+		at := time.Unix(0, nanos)
+		if at.After(countCutoff) {
+			distinct[id] = struct{}{}
+		}
+		if !at.After(pruneCutoff) {
+			batch.Delete(iter.Key())
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+	if err := s.db.Write(batch, nil); err != nil {
+		return 0, err
+	}
+
+	return int64(len(distinct)), nil
+}
+
+func (s *levelDBStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// webhookJob is a single pending delivery of the unique-request
+// notification to a caller-supplied endpoint.
+type webhookJob struct {
+	Endpoint string
+	Payload  []byte
+	Attempt  int
+}
+
+// Webhook delivery configuration, overridable via env vars.
+var (
+	webhookQueueSize   = 1000
+	webhookWorkers     = 4
+	webhookMaxAttempts = 5
+	webhookTimeout     = 5 * time.Second
+)
+
+const (
+	webhookBackoffBase = 100 * time.Millisecond
+	webhookBackoffCap  = 30 * time.Second
+)
+
+// webhookFailedTotal counts jobs that exhausted webhookMaxAttempts and
+// were written to the dead-letter file.
+var webhookFailedTotal int64
+
+var (
+	webhookQueue         chan webhookJob
+	webhookHTTPClient    *http.Client
+	webhookDeadLetterLog *os.File
+	webhookDeadLetterMu  sync.Mutex
+)
+
+func init() {
+	if v := os.Getenv("WEBHOOK_QUEUE_SIZE"); v != "" {
+		if n, err := parsePositiveInt(v); err == nil {
+			webhookQueueSize = n
+		} else {
+			log.Printf("Ignoring invalid WEBHOOK_QUEUE_SIZE %q: %v", v, err)
+		}
+	}
+	if v := os.Getenv("WEBHOOK_WORKERS"); v != "" {
+		if n, err := parsePositiveInt(v); err == nil {
+			webhookWorkers = n
+		} else {
+			log.Printf("Ignoring invalid WEBHOOK_WORKERS %q: %v", v, err)
+		}
+	}
+	if v := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); v != "" {
+		if n, err := parsePositiveInt(v); err == nil {
+			webhookMaxAttempts = n
+		} else {
+			log.Printf("Ignoring invalid WEBHOOK_MAX_ATTEMPTS %q: %v", v, err)
+		}
+	}
+	if v := os.Getenv("WEBHOOK_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			webhookTimeout = d
+		} else {
+			log.Printf("Ignoring invalid WEBHOOK_TIMEOUT %q: %v", v, err)
+		}
+	}
+
+	webhookQueue = make(chan webhookJob, webhookQueueSize)
+	webhookHTTPClient = &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 20,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+
+	var err error
+	webhookDeadLetterLog, err = os.OpenFile("webhook_dead_letter.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		log.Fatalf("Failed to open webhook dead-letter log: %v", err)
+	}
+}
+
+func parsePositiveInt(v string) (int, error) {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("must be positive, got %d", n)
+	}
+	return n, nil
+}
+
+// startWebhookWorkers launches the webhook delivery worker pool. Workers
+// run until ctx is cancelled.
+func startWebhookWorkers(ctx context.Context) {
+	for i := 0; i < webhookWorkers; i++ {
+		go webhookWorker(ctx)
+	}
+}
+
+func webhookWorker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-webhookQueue:
+			deliverWebhook(ctx, job)
+		}
+	}
+}
+
+// enqueueWebhook builds the notification payload for endpoint and enqueues
+// it for asynchronous delivery. It returns an error if the queue is full,
+// so the caller can respond accordingly instead of blocking on downstream
+// availability.
+func enqueueWebhook(endpoint string) error {
+	payload, err := json.Marshal(map[string]string{"message": "Unique request data"})
+	if err != nil {
+		return fmt.Errorf("encoding webhook payload: %w", err)
+	}
+
+	job := webhookJob{Endpoint: endpoint, Payload: payload, Attempt: 1}
+	select {
+	case webhookQueue <- job:
+		return nil
+	default:
+		return fmt.Errorf("webhook queue full (capacity %d)", webhookQueueSize)
+	}
+}
+
+// deliverWebhook attempts a single POST for job. A transport error or a
+// non-2xx response from the endpoint is treated as a failure: it schedules
+// a retry with exponential backoff and jitter, and once webhookMaxAttempts
+// is exhausted, the job is written to the dead-letter log and
+// webhookFailedTotal is incremented.
+func deliverWebhook(ctx context.Context, job webhookJob) {
+	resp, err := webhookHTTPClient.Post(job.Endpoint, "application/json", bytes.NewReader(job.Payload))
+	if err == nil {
+		defer resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			log.Printf("Triggered endpoint: %s with status code: %d (attempt %d)", job.Endpoint, resp.StatusCode, job.Attempt)
+			return
+		}
+		err = fmt.Errorf("endpoint returned status code %d", resp.StatusCode)
+	}
+
+	log.Printf("Webhook delivery to %s failed (attempt %d/%d): %v", job.Endpoint, job.Attempt, webhookMaxAttempts, err)
+
+	if job.Attempt >= webhookMaxAttempts {
+		deadLetterWebhook(job, err)
+		return
+	}
+
+	next := job
+	next.Attempt++
+	delay := webhookBackoff(next.Attempt - 1)
+	go func() {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+			select {
+			case webhookQueue <- next:
+			case <-ctx.Done():
+			}
+		}
+	}()
+}
+
+// webhookBackoff returns the exponential backoff with equal jitter for the
+// given attempt number (1-indexed): 100ms, 200ms, 400ms, ... capped at
+// webhookBackoffCap.
+func webhookBackoff(attempt int) time.Duration {
+	d := webhookBackoffBase << uint(attempt-1)
+	if d <= 0 || d > webhookBackoffCap {
+		d = webhookBackoffCap
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// deadLetterWebhook records a terminally-failed job and bumps the failure
+// counter.
+func deadLetterWebhook(job webhookJob, lastErr error) {
+	atomic.AddInt64(&webhookFailedTotal, 1)
+
+	webhookDeadLetterMu.Lock()
+	_, err := fmt.Fprintf(webhookDeadLetterLog, "%s endpoint=%s attempts=%d error=%v payload=%s\n",
+		time.Now().UTC().Format(time.RFC3339), job.Endpoint, job.Attempt, lastErr, job.Payload)
+	webhookDeadLetterMu.Unlock()
+	if err != nil {
+		log.Printf("Error writing to webhook dead-letter log: %v", err)
+	}
+}